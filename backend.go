@@ -0,0 +1,223 @@
+package cbindex
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	IndexBackendNotMutableError = errors.New("index backend does not support incremental updates")
+)
+
+// IndexEntry records where one row lives in the data file: its byte
+// offset, its encoded length (so a lookup can ReadAt the exact span
+// without scanning), and the xxhash checksum of those bytes.
+type IndexEntry struct {
+	Offset   int64
+	Length   int64
+	Checksum uint64
+}
+
+type Iterator interface {
+	Next() bool
+	// Key returns the IndexKeyLength bucket key the current entry was
+	// indexed under. More than one entry can share a Key when distinct
+	// full row keys collide on their first IndexKeyLength bytes.
+	Key() string
+	Offset() int64
+	Length() int64
+	Checksum() uint64
+	Err() error
+	Close() error
+}
+
+type IndexBackend interface {
+	// Lookup returns every entry recorded under key's bucket, in the
+	// order they were indexed. A bucket holds more than one entry when
+	// more than one distinct full row key shares key's IndexKeyLength
+	// prefix; callers disambiguate by reading and checking each entry's
+	// row in turn.
+	Lookup(key string) ([]IndexEntry, error)
+	RangeScan(prefix string) (Iterator, error)
+	// Seek returns an Iterator over every bucket key >= key, in sorted
+	// order, unbounded by any prefix. Used for ordered iteration that
+	// starts partway through the key space.
+	Seek(key string) (Iterator, error)
+	Close() error
+}
+
+type MutableIndexBackend interface {
+	IndexBackend
+	// Insert records one more entry under key's bucket. It never
+	// overwrites an existing entry for the bucket, since more than one
+	// row can legitimately share a bucket key.
+	Insert(key string, entry IndexEntry) error
+}
+
+type MemoryMapIndex struct {
+	mu      sync.RWMutex
+	entries map[string][]IndexEntry
+	sorted  []string
+}
+
+func NewMemoryMapIndex() *MemoryMapIndex {
+	return &MemoryMapIndex{
+		entries: make(map[string][]IndexEntry),
+	}
+}
+
+func LoadMemoryMapIndex(indexCsvPath string) (*MemoryMapIndex, error) {
+	indexFile, e := os.Open(indexCsvPath)
+	if e != nil {
+		return nil, e
+	}
+	defer indexFile.Close()
+
+	m := NewMemoryMapIndex()
+
+	indexCsv := csv.NewReader(indexFile)
+	indexCsv.FieldsPerRecord = -1
+	for true {
+		line, e := indexCsv.Read()
+		if errors.Is(e, io.EOF) {
+			break
+		}
+
+		if len(line) < 4 {
+			continue
+		}
+
+		key := line[0]
+		offset, e := strconv.ParseInt(line[1], 10, 64)
+		if e != nil {
+			continue
+		}
+		length, e := strconv.ParseInt(line[2], 10, 64)
+		if e != nil {
+			continue
+		}
+		checksum, e := strconv.ParseUint(line[3], 10, 64)
+		if e != nil {
+			continue
+		}
+
+		if _, exists := m.entries[key]; !exists {
+			m.sorted = append(m.sorted, key)
+		}
+		m.entries[key] = append(m.entries[key], IndexEntry{Offset: offset, Length: length, Checksum: checksum})
+	}
+
+	sort.Strings(m.sorted)
+
+	return m, nil
+}
+
+func (m *MemoryMapIndex) Lookup(key string) ([]IndexEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]IndexEntry, len(m.entries[key]))
+	copy(entries, m.entries[key])
+	return entries, nil
+}
+
+func (m *MemoryMapIndex) Insert(key string, entry IndexEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.entries[key]; !exists {
+		i := sort.SearchStrings(m.sorted, key)
+		m.sorted = append(m.sorted, "")
+		copy(m.sorted[i+1:], m.sorted[i:])
+		m.sorted[i] = key
+	}
+
+	m.entries[key] = append(m.entries[key], entry)
+	return nil
+}
+
+func (m *MemoryMapIndex) RangeScan(prefix string) (Iterator, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	start := sort.Search(len(m.sorted), func(i int) bool {
+		return m.sorted[i] >= prefix || strings.HasPrefix(m.sorted[i], prefix)
+	})
+
+	var rows []memoryMapRow
+	for _, key := range m.sorted[start:] {
+		if !strings.HasPrefix(key, prefix) && key > prefix {
+			break
+		}
+		for _, entry := range m.entries[key] {
+			rows = append(rows, memoryMapRow{key: key, entry: entry})
+		}
+	}
+
+	return &memoryMapIterator{rows: rows, cursor: -1}, nil
+}
+
+func (m *MemoryMapIndex) Seek(key string) (Iterator, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	start := sort.SearchStrings(m.sorted, key)
+
+	var rows []memoryMapRow
+	for _, bucketKey := range m.sorted[start:] {
+		for _, entry := range m.entries[bucketKey] {
+			rows = append(rows, memoryMapRow{key: bucketKey, entry: entry})
+		}
+	}
+
+	return &memoryMapIterator{rows: rows, cursor: -1}, nil
+}
+
+func (m *MemoryMapIndex) Close() error {
+	return nil
+}
+
+type memoryMapRow struct {
+	key   string
+	entry IndexEntry
+}
+
+type memoryMapIterator struct {
+	rows   []memoryMapRow
+	cursor int
+}
+
+func (it *memoryMapIterator) Next() bool {
+	it.cursor++
+	return it.cursor < len(it.rows)
+}
+
+func (it *memoryMapIterator) Key() string {
+	return it.rows[it.cursor].key
+}
+
+func (it *memoryMapIterator) Offset() int64 {
+	return it.rows[it.cursor].entry.Offset
+}
+
+func (it *memoryMapIterator) Length() int64 {
+	return it.rows[it.cursor].entry.Length
+}
+
+func (it *memoryMapIterator) Checksum() uint64 {
+	return it.rows[it.cursor].entry.Checksum
+}
+
+func (it *memoryMapIterator) Err() error {
+	return nil
+}
+
+func (it *memoryMapIterator) Close() error {
+	return nil
+}
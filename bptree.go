@@ -0,0 +1,733 @@
+package cbindex
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	bpTreePageSize    = 4096
+	bpTreeLeafPage    = byte(1)
+	bpTreeInternalPage = byte(2)
+
+	// bpTreeLeafPageHeader is pageType(1) + numEntries(2) + nextLeaf(8).
+	bpTreeLeafPageHeader = 1 + 2 + 8
+	// bpTreeInternalPageHeader is pageType(1) + numEntries(2).
+	bpTreeInternalPageHeader = 1 + 2
+)
+
+var (
+	BPTreeCorruptError = errors.New("bptree index file is corrupt")
+)
+
+type bpTreeHeader struct {
+	keyLength int
+	rootPage  int64
+	pageCount int64
+}
+
+type bpTreeLeafEntry struct {
+	key      string
+	offset   int64
+	length   int64
+	checksum uint64
+}
+
+type bpTreeInternalEntry struct {
+	key   string
+	child int64
+}
+
+// BPTreeIndex is an on-disk paged B+ tree IndexBackend. It is built
+// once by BuildBPTreeIndex and opened read-only, so lookups touch a
+// small, LRU-cached number of 4 KiB pages instead of holding the whole
+// index in memory.
+type BPTreeIndex struct {
+	file   *os.File
+	header bpTreeHeader
+	cache  *bpTreePageCache
+}
+
+func OpenBPTreeIndex(path string, cachePages int) (*BPTreeIndex, error) {
+	file, e := os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+
+	header, e := readBPTreeHeader(file)
+	if e != nil {
+		file.Close()
+		return nil, e
+	}
+
+	return &BPTreeIndex{
+		file:   file,
+		header: header,
+		cache:  newBPTreePageCache(cachePages),
+	}, nil
+}
+
+// Lookup collects every leaf entry recorded under key, which can span
+// more than one leaf page when a bucket's entries overflowed a single
+// page during the build.
+func (b *BPTreeIndex) Lookup(key string) ([]IndexEntry, error) {
+	pageID := b.header.rootPage
+
+	var page *bpTreePage
+	for true {
+		var e error
+		page, e = b.loadPage(pageID)
+		if e != nil {
+			return nil, e
+		}
+
+		if page.pageType == bpTreeLeafPage {
+			break
+		}
+
+		pageID = descendInternal(page, key)
+	}
+
+	i := firstLeafIndexGTE(page, key)
+
+	var entries []IndexEntry
+	for true {
+		if i >= len(page.leafEntries) {
+			if page.nextLeaf == 0 {
+				break
+			}
+			next, e := b.loadPage(page.nextLeaf)
+			if e != nil {
+				return nil, e
+			}
+			page = next
+			i = 0
+			continue
+		}
+
+		entry := page.leafEntries[i]
+		if entry.key != key {
+			break
+		}
+
+		entries = append(entries, IndexEntry{Offset: entry.offset, Length: entry.length, Checksum: entry.checksum})
+		i++
+	}
+
+	return entries, nil
+}
+
+func (b *BPTreeIndex) RangeScan(prefix string) (Iterator, error) {
+	pageID := b.header.rootPage
+
+	for true {
+		page, e := b.loadPage(pageID)
+		if e != nil {
+			return nil, e
+		}
+
+		if page.pageType == bpTreeLeafPage {
+			return &bpTreeIterator{tree: b, page: page, cursor: firstLeafIndexGTE(page, prefix) - 1, prefix: prefix}, nil
+		}
+
+		pageID = descendInternal(page, prefix)
+	}
+
+	return nil, BPTreeCorruptError
+}
+
+func (b *BPTreeIndex) Seek(key string) (Iterator, error) {
+	pageID := b.header.rootPage
+
+	for true {
+		page, e := b.loadPage(pageID)
+		if e != nil {
+			return nil, e
+		}
+
+		if page.pageType == bpTreeLeafPage {
+			return &bpTreeIterator{tree: b, page: page, cursor: firstLeafIndexGTE(page, key) - 1, unbounded: true}, nil
+		}
+
+		pageID = descendInternal(page, key)
+	}
+
+	return nil, BPTreeCorruptError
+}
+
+func (b *BPTreeIndex) Close() error {
+	return b.file.Close()
+}
+
+func (b *BPTreeIndex) loadPage(pageID int64) (*bpTreePage, error) {
+	if page, ok := b.cache.get(pageID); ok {
+		return page, nil
+	}
+
+	buf := make([]byte, bpTreePageSize)
+	if _, e := b.file.ReadAt(buf, pageID*bpTreePageSize); e != nil {
+		return nil, e
+	}
+
+	page, e := decodeBPTreePage(buf)
+	if e != nil {
+		return nil, e
+	}
+
+	b.cache.put(pageID, page)
+	return page, nil
+}
+
+// descendInternal picks the leftmost child that can hold key. A
+// separator equal to key sends the search left, since a bucket's
+// entries can start on an earlier leaf; callers walk forward from there.
+func descendInternal(page *bpTreePage, key string) int64 {
+	i := sort.Search(len(page.internalEntries), func(i int) bool {
+		return page.internalEntries[i].key >= key
+	})
+	return page.internalChildren[i]
+}
+
+func firstLeafIndexGTE(page *bpTreePage, key string) int {
+	return sort.Search(len(page.leafEntries), func(i int) bool {
+		return page.leafEntries[i].key >= key || (len(page.leafEntries[i].key) >= len(key) && page.leafEntries[i].key[:len(key)] >= key)
+	})
+}
+
+type bpTreeIterator struct {
+	tree      *BPTreeIndex
+	page      *bpTreePage
+	cursor    int
+	prefix    string
+	unbounded bool
+	err       error
+}
+
+func (it *bpTreeIterator) Next() bool {
+	it.cursor++
+	for true {
+		if it.cursor < len(it.page.leafEntries) {
+			if it.unbounded {
+				return true
+			}
+
+			key := it.page.leafEntries[it.cursor].key
+			if len(key) >= len(it.prefix) && key[:len(it.prefix)] == it.prefix {
+				return true
+			}
+			if key > it.prefix {
+				return false
+			}
+			it.cursor++
+			continue
+		}
+
+		if it.page.nextLeaf == 0 {
+			return false
+		}
+
+		page, e := it.tree.loadPage(it.page.nextLeaf)
+		if e != nil {
+			it.err = e
+			return false
+		}
+		it.page = page
+		it.cursor = 0
+	}
+	return false
+}
+
+func (it *bpTreeIterator) Key() string {
+	return it.page.leafEntries[it.cursor].key
+}
+
+func (it *bpTreeIterator) Offset() int64 {
+	return it.page.leafEntries[it.cursor].offset
+}
+
+func (it *bpTreeIterator) Length() int64 {
+	return it.page.leafEntries[it.cursor].length
+}
+
+func (it *bpTreeIterator) Checksum() uint64 {
+	return it.page.leafEntries[it.cursor].checksum
+}
+
+func (it *bpTreeIterator) Err() error {
+	return it.err
+}
+
+func (it *bpTreeIterator) Close() error {
+	return nil
+}
+
+type bpTreePage struct {
+	pageType         byte
+	leafEntries      []bpTreeLeafEntry
+	nextLeaf         int64
+	internalEntries  []bpTreeInternalEntry
+	internalChildren []int64
+}
+
+func decodeBPTreePage(buf []byte) (*bpTreePage, error) {
+	r := bytes.NewReader(buf)
+
+	pageType, e := r.ReadByte()
+	if e != nil {
+		return nil, e
+	}
+
+	var numEntries uint16
+	if e := binary.Read(r, binary.BigEndian, &numEntries); e != nil {
+		return nil, e
+	}
+
+	page := &bpTreePage{pageType: pageType}
+
+	if pageType == bpTreeLeafPage {
+		var nextLeaf int64
+		if e := binary.Read(r, binary.BigEndian, &nextLeaf); e != nil {
+			return nil, e
+		}
+		page.nextLeaf = nextLeaf
+
+		for i := uint16(0); i < numEntries; i++ {
+			entry, e := readBPTreeLeafEntry(r)
+			if e != nil {
+				return nil, e
+			}
+			page.leafEntries = append(page.leafEntries, entry)
+		}
+		return page, nil
+	}
+
+	if pageType != bpTreeInternalPage {
+		return nil, BPTreeCorruptError
+	}
+
+	for i := uint16(0); i <= numEntries; i++ {
+		var child int64
+		if e := binary.Read(r, binary.BigEndian, &child); e != nil {
+			return nil, e
+		}
+		page.internalChildren = append(page.internalChildren, child)
+
+		if i < numEntries {
+			key, e := readBPTreeKey(r)
+			if e != nil {
+				return nil, e
+			}
+			page.internalEntries = append(page.internalEntries, bpTreeInternalEntry{key: key, child: child})
+		}
+	}
+
+	return page, nil
+}
+
+func readBPTreeKey(r *bytes.Reader) (string, error) {
+	var keyLen uint16
+	if e := binary.Read(r, binary.BigEndian, &keyLen); e != nil {
+		return "", e
+	}
+	key := make([]byte, keyLen)
+	if _, e := io.ReadFull(r, key); e != nil {
+		return "", e
+	}
+	return string(key), nil
+}
+
+func readBPTreeLeafEntry(r *bytes.Reader) (bpTreeLeafEntry, error) {
+	key, e := readBPTreeKey(r)
+	if e != nil {
+		return bpTreeLeafEntry{}, e
+	}
+
+	var offset int64
+	if e := binary.Read(r, binary.BigEndian, &offset); e != nil {
+		return bpTreeLeafEntry{}, e
+	}
+
+	var length int64
+	if e := binary.Read(r, binary.BigEndian, &length); e != nil {
+		return bpTreeLeafEntry{}, e
+	}
+
+	var checksum uint64
+	if e := binary.Read(r, binary.BigEndian, &checksum); e != nil {
+		return bpTreeLeafEntry{}, e
+	}
+
+	return bpTreeLeafEntry{key: key, offset: offset, length: length, checksum: checksum}, nil
+}
+
+func readBPTreeHeader(file *os.File) (bpTreeHeader, error) {
+	buf := make([]byte, bpTreePageSize)
+	if _, e := file.ReadAt(buf, 0); e != nil {
+		return bpTreeHeader{}, e
+	}
+
+	r := bytes.NewReader(buf)
+
+	var magic uint32
+	if e := binary.Read(r, binary.BigEndian, &magic); e != nil {
+		return bpTreeHeader{}, e
+	}
+	if magic != bpTreeMagic {
+		return bpTreeHeader{}, BPTreeCorruptError
+	}
+
+	var keyLength uint16
+	var rootPage, pageCount int64
+	if e := binary.Read(r, binary.BigEndian, &keyLength); e != nil {
+		return bpTreeHeader{}, e
+	}
+	if e := binary.Read(r, binary.BigEndian, &rootPage); e != nil {
+		return bpTreeHeader{}, e
+	}
+	if e := binary.Read(r, binary.BigEndian, &pageCount); e != nil {
+		return bpTreeHeader{}, e
+	}
+
+	return bpTreeHeader{keyLength: int(keyLength), rootPage: rootPage, pageCount: pageCount}, nil
+}
+
+const bpTreeMagic = uint32(0xcb1de5)
+
+// BuildBPTreeIndex streams dataCsvPath once, recording every row's
+// offset/length/checksum under its keyLen-byte key prefix (the same
+// bucket semantics as the flat index CSV), sorts those entries stably
+// by key, and bulk-loads them bottom-up into a paged B+ tree file at
+// outPath. It assumes CSV-formatted rows; use BuildBPTreeIndexWithFormat
+// for any other RowFormat.
+func BuildBPTreeIndex(dataCsvPath, outPath string, keyLen int) error {
+	return BuildBPTreeIndexWithFormat(dataCsvPath, outPath, keyLen, CSVRowFormat{})
+}
+
+// BuildBPTreeIndexWithFormat is BuildBPTreeIndex for data files encoded
+// with a RowFormat other than CSV.
+func BuildBPTreeIndexWithFormat(dataCsvPath, outPath string, keyLen int, format RowFormat) error {
+	dataFile, e := os.Open(dataCsvPath)
+	if e != nil {
+		return e
+	}
+	defer dataFile.Close()
+
+	counting := &countingReader{r: dataFile}
+	rowReader := format.NewReader(counting)
+
+	var entries []bpTreeLeafEntry
+
+	for true {
+		rowStart := counting.offset
+		line, e := rowReader.Read()
+		if errors.Is(e, io.EOF) {
+			break
+		}
+		if e != nil {
+			return e
+		}
+
+		rowKey := format.KeyOf(line)
+		if len(rowKey) < keyLen {
+			continue
+		}
+		key := rowKey[:keyLen]
+
+		rowBytes, e := format.EncodeRow(line)
+		if e != nil {
+			return e
+		}
+
+		entries = append(entries, bpTreeLeafEntry{key: key, offset: rowStart, length: int64(len(rowBytes)), checksum: xxhash.Sum64(rowBytes)})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	return writeBPTreeFile(outPath, keyLen, entries)
+}
+
+func writeBPTreeFile(outPath string, keyLen int, entries []bpTreeLeafEntry) error {
+	outFile, e := os.Create(outPath)
+	if e != nil {
+		return e
+	}
+	defer outFile.Close()
+
+	// page 0 is reserved for the header; real pages start at 1
+	nextPageID := int64(1)
+
+	leafBounds, e := splitLeafEntries(entries)
+	if e != nil {
+		return e
+	}
+
+	leafPageIDs := make([]int64, len(leafBounds))
+	for i := range leafBounds {
+		leafPageIDs[i] = nextPageID
+		nextPageID++
+	}
+
+	leafKeys := make([][]byte, 0, len(leafBounds))
+	for i, bounds := range leafBounds {
+		start, end := bounds[0], bounds[1]
+
+		var nextLeaf int64
+		if i+1 < len(leafPageIDs) {
+			nextLeaf = leafPageIDs[i+1]
+		}
+
+		page, e := encodeBPTreeLeafPage(entries[start:end], nextLeaf)
+		if e != nil {
+			return e
+		}
+		if _, e := outFile.WriteAt(page, leafPageIDs[i]*bpTreePageSize); e != nil {
+			return e
+		}
+
+		leafKeys = append(leafKeys, []byte(entries[start].key))
+	}
+
+	if len(leafPageIDs) == 0 {
+		emptyLeaf, e := encodeBPTreeLeafPage(nil, 0)
+		if e != nil {
+			return e
+		}
+		if _, e := outFile.WriteAt(emptyLeaf, bpTreePageSize); e != nil {
+			return e
+		}
+		leafPageIDs = []int64{1}
+		nextPageID = 2
+	}
+
+	levelIDs := leafPageIDs
+	levelKeys := leafKeys
+
+	for len(levelIDs) > 1 {
+		var parentIDs []int64
+		var parentKeys [][]byte
+
+		for i := 0; i < len(levelIDs); {
+			end, e := internalGroupEnd(levelKeys, i, len(levelIDs))
+			if e != nil {
+				return e
+			}
+
+			children := levelIDs[i:end]
+			separators := levelKeys[i+1 : end]
+
+			pageID := nextPageID
+			nextPageID++
+
+			page, e := encodeBPTreeInternalPage(separators, children)
+			if e != nil {
+				return e
+			}
+			if _, e := outFile.WriteAt(page, pageID*bpTreePageSize); e != nil {
+				return e
+			}
+
+			parentIDs = append(parentIDs, pageID)
+			parentKeys = append(parentKeys, levelKeys[i])
+
+			i = end
+		}
+
+		levelIDs = parentIDs
+		levelKeys = parentKeys
+	}
+
+	header := encodeBPTreeHeader(keyLen, levelIDs[0], nextPageID-1)
+	if _, e := outFile.WriteAt(header, 0); e != nil {
+		return e
+	}
+
+	return nil
+}
+
+// splitLeafEntries groups entries into the fewest leaf pages that each
+// fit within bpTreePageSize, returning each group as a [start, end)
+// pair into entries. It errors if a single entry's encoded size alone
+// can't fit in a page, since no split can help that case.
+func splitLeafEntries(entries []bpTreeLeafEntry) ([][2]int, error) {
+	var bounds [][2]int
+
+	for start := 0; start < len(entries); {
+		size := bpTreeLeafPageHeader
+		end := start
+		for end < len(entries) {
+			entrySize := leafEntryEncodedSize(entries[end])
+			if end == start && bpTreeLeafPageHeader+entrySize > bpTreePageSize {
+				return nil, fmt.Errorf("bptree leaf entry for key %q encodes to %d bytes, which does not fit in a %d byte page", entries[end].key, entrySize, bpTreePageSize)
+			}
+			if size+entrySize > bpTreePageSize {
+				break
+			}
+			size += entrySize
+			end++
+		}
+		bounds = append(bounds, [2]int{start, end})
+		start = end
+	}
+
+	return bounds, nil
+}
+
+func leafEntryEncodedSize(entry bpTreeLeafEntry) int {
+	return 2 + len(entry.key) + 8 + 8 + 8
+}
+
+// internalGroupEnd returns the end of the widest run of children
+// starting at start, among levelIDs[start:n], whose encoded internal
+// page (that run's children plus the separators between them) fits
+// within bpTreePageSize. It errors if even a lone child can't fit,
+// since no split can help that case.
+func internalGroupEnd(levelKeys [][]byte, start, n int) (int, error) {
+	const childSize = 8
+
+	size := bpTreeInternalPageHeader + childSize
+	if size > bpTreePageSize {
+		return 0, fmt.Errorf("bptree internal page child entry encodes to %d bytes, which does not fit in a %d byte page", childSize, bpTreePageSize)
+	}
+
+	end := start + 1
+	for end < n {
+		sepSize := 2 + len(levelKeys[end])
+		if size+sepSize+childSize > bpTreePageSize {
+			break
+		}
+		size += sepSize + childSize
+		end++
+	}
+
+	return end, nil
+}
+
+func encodeBPTreeHeader(keyLen int, rootPage, pageCount int64) []byte {
+	buf := make([]byte, bpTreePageSize)
+	w := bytes.NewBuffer(buf[:0])
+	binary.Write(w, binary.BigEndian, bpTreeMagic)
+	binary.Write(w, binary.BigEndian, uint16(keyLen))
+	binary.Write(w, binary.BigEndian, rootPage)
+	binary.Write(w, binary.BigEndian, pageCount)
+	return buf
+}
+
+// encodeBPTreeLeafPage encodes entries into a bpTreePageSize page. It
+// writes into a freely growing buffer rather than the fixed-size page
+// directly, so an encoding that doesn't fit is caught as an explicit
+// error instead of silently reallocating out from under the returned
+// slice and writing a truncated page.
+func encodeBPTreeLeafPage(entries []bpTreeLeafEntry, nextLeaf int64) ([]byte, error) {
+	var body bytes.Buffer
+	body.WriteByte(bpTreeLeafPage)
+	binary.Write(&body, binary.BigEndian, uint16(len(entries)))
+	binary.Write(&body, binary.BigEndian, nextLeaf)
+	for _, entry := range entries {
+		binary.Write(&body, binary.BigEndian, uint16(len(entry.key)))
+		body.WriteString(entry.key)
+		binary.Write(&body, binary.BigEndian, entry.offset)
+		binary.Write(&body, binary.BigEndian, entry.length)
+		binary.Write(&body, binary.BigEndian, entry.checksum)
+	}
+
+	if body.Len() > bpTreePageSize {
+		return nil, fmt.Errorf("bptree leaf page with %d entries encodes to %d bytes, exceeding the %d byte page size", len(entries), body.Len(), bpTreePageSize)
+	}
+
+	page := make([]byte, bpTreePageSize)
+	copy(page, body.Bytes())
+	return page, nil
+}
+
+// encodeBPTreeInternalPage encodes separators/children into a
+// bpTreePageSize page. See encodeBPTreeLeafPage for why it builds into
+// a freely growing buffer instead of writing directly into the page.
+func encodeBPTreeInternalPage(separators [][]byte, children []int64) ([]byte, error) {
+	var body bytes.Buffer
+	body.WriteByte(bpTreeInternalPage)
+	binary.Write(&body, binary.BigEndian, uint16(len(separators)))
+	for i, child := range children {
+		binary.Write(&body, binary.BigEndian, child)
+		if i < len(separators) {
+			binary.Write(&body, binary.BigEndian, uint16(len(separators[i])))
+			body.Write(separators[i])
+		}
+	}
+
+	if body.Len() > bpTreePageSize {
+		return nil, fmt.Errorf("bptree internal page with %d children encodes to %d bytes, exceeding the %d byte page size", len(children), body.Len(), bpTreePageSize)
+	}
+
+	page := make([]byte, bpTreePageSize)
+	copy(page, body.Bytes())
+	return page, nil
+}
+
+type bpTreePageCacheEntry struct {
+	pageID int64
+	page   *bpTreePage
+}
+
+// bpTreePageCache is a small LRU cache keyed by page ID so warm lookups
+// typically resolve after touching 1-2 pages rather than re-reading and
+// re-decoding a page from disk on every call.
+type bpTreePageCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[int64]*list.Element
+}
+
+func newBPTreePageCache(capacity int) *bpTreePageCache {
+	if capacity <= 0 {
+		capacity = 256
+	}
+	return &bpTreePageCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[int64]*list.Element),
+	}
+}
+
+func (c *bpTreePageCache) get(pageID int64) (*bpTreePage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[pageID]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*bpTreePageCacheEntry).page, true
+}
+
+func (c *bpTreePageCache) put(pageID int64, page *bpTreePage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[pageID]; ok {
+		el.Value.(*bpTreePageCacheEntry).page = page
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	el := c.ll.PushFront(&bpTreePageCacheEntry{pageID: pageID, page: page})
+	c.items[pageID] = el
+
+	if c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		if oldest != nil {
+			c.ll.Remove(oldest)
+			delete(c.items, oldest.Value.(*bpTreePageCacheEntry).pageID)
+		}
+	}
+}
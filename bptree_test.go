@@ -0,0 +1,133 @@
+package cbindex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBPTreeBuildAndLookupRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "data.csv")
+	treePath := filepath.Join(dir, "index.bptree")
+
+	const keyLen = 15
+	const rowCount = 300
+
+	var sb strings.Builder
+	for i := 0; i < rowCount; i++ {
+		key := fmt.Sprintf("%0*d", keyLen, i)
+		fmt.Fprintf(&sb, "%s,value-%d\n", key, i)
+	}
+	if e := os.WriteFile(dataPath, []byte(sb.String()), 0644); e != nil {
+		t.Fatalf("write data file: %v", e)
+	}
+
+	// rowCount * 15-byte keys comfortably overflows a single 4096 byte
+	// page, exercising the dynamic page-splitting path.
+	if e := BuildBPTreeIndex(dataPath, treePath, keyLen); e != nil {
+		t.Fatalf("BuildBPTreeIndex: %v", e)
+	}
+
+	tree, e := OpenBPTreeIndex(treePath, 16)
+	if e != nil {
+		t.Fatalf("OpenBPTreeIndex: %v", e)
+	}
+	defer tree.Close()
+
+	for i := 0; i < rowCount; i++ {
+		key := fmt.Sprintf("%0*d", keyLen, i)
+		entries, e := tree.Lookup(key)
+		if e != nil {
+			t.Fatalf("Lookup(%q): %v", key, e)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("Lookup(%q): got %d entries, want 1", key, len(entries))
+		}
+		offset := entries[0].Offset
+
+		data, e := os.ReadFile(dataPath)
+		if e != nil {
+			t.Fatalf("read data file: %v", e)
+		}
+		want := fmt.Sprintf("%s,value-%d\n", key, i)
+		if int(offset)+len(want) > len(data) || string(data[offset:int(offset)+len(want)]) != want {
+			t.Fatalf("Lookup(%q) offset %d does not point at %q", key, offset, want)
+		}
+	}
+
+	if entries, e := tree.Lookup(fmt.Sprintf("%0*d", keyLen, rowCount+1)); e != nil || len(entries) != 0 {
+		t.Fatalf("Lookup of missing key returned entries=%v err=%v", entries, e)
+	}
+}
+
+func TestBPTreeLookupReturnsAllEntriesSharingABucketKey(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "data.csv")
+	treePath := filepath.Join(dir, "index.bptree")
+
+	rows := "aaa001,1\naaa002,2\nbbb001,3\n"
+	if e := os.WriteFile(dataPath, []byte(rows), 0644); e != nil {
+		t.Fatalf("write data file: %v", e)
+	}
+
+	if e := BuildBPTreeIndex(dataPath, treePath, 3); e != nil {
+		t.Fatalf("BuildBPTreeIndex: %v", e)
+	}
+
+	tree, e := OpenBPTreeIndex(treePath, 16)
+	if e != nil {
+		t.Fatalf("OpenBPTreeIndex: %v", e)
+	}
+	defer tree.Close()
+
+	entries, e := tree.Lookup("aaa")
+	if e != nil {
+		t.Fatalf("Lookup: %v", e)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Lookup(\"aaa\") returned %d entries, want 2 (one per row sharing the bucket key)", len(entries))
+	}
+}
+
+func TestBPTreeRangeScanIsPrefixBounded(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "data.csv")
+	treePath := filepath.Join(dir, "index.bptree")
+
+	rows := "aaa001,1\naaa002,2\nbbb001,3\n"
+	if e := os.WriteFile(dataPath, []byte(rows), 0644); e != nil {
+		t.Fatalf("write data file: %v", e)
+	}
+
+	if e := BuildBPTreeIndex(dataPath, treePath, 3); e != nil {
+		t.Fatalf("BuildBPTreeIndex: %v", e)
+	}
+
+	tree, e := OpenBPTreeIndex(treePath, 16)
+	if e != nil {
+		t.Fatalf("OpenBPTreeIndex: %v", e)
+	}
+	defer tree.Close()
+
+	it, e := tree.RangeScan("aaa")
+	if e != nil {
+		t.Fatalf("RangeScan: %v", e)
+	}
+	defer it.Close()
+
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	if e := it.Err(); e != nil {
+		t.Fatalf("iterator error: %v", e)
+	}
+	// "aaa001" and "aaa002" both fall in the "aaa" bucket, so RangeScan
+	// yields one entry per row, not one per bucket key.
+	if len(keys) != 2 || keys[0] != "aaa" || keys[1] != "aaa" {
+		t.Fatalf("RangeScan(\"aaa\") returned %v, want [aaa aaa]", keys)
+	}
+}
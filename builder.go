@@ -0,0 +1,263 @@
+package cbindex
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+var ChecksumMismatchError = errors.New("index checksum does not match data file contents")
+
+type FileIndexBuilder struct {
+	fileIndex *FileIndex
+
+	mu         sync.Mutex
+	dataFile   *os.File
+	indexFile  *os.File
+	dataOffset int64
+}
+
+func NewFileIndexBuilder(fileIndex *FileIndex) (*FileIndexBuilder, error) {
+	if _, ok := fileIndex.backend.(MutableIndexBackend); !ok {
+		return nil, IndexBackendNotMutableError
+	}
+
+	dataFile, e := os.OpenFile(fileIndex.dataCsvPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if e != nil {
+		return nil, e
+	}
+
+	indexFile, e := os.OpenFile(fileIndex.indexCsvPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if e != nil {
+		dataFile.Close()
+		return nil, e
+	}
+
+	builder := &FileIndexBuilder{
+		fileIndex:  fileIndex,
+		dataFile:   dataFile,
+		indexFile:  indexFile,
+		dataOffset: atomic.LoadInt64(&fileIndex.dataEndOffset),
+	}
+
+	if e := builder.Sync(); e != nil {
+		dataFile.Close()
+		indexFile.Close()
+		return nil, e
+	}
+
+	return builder, nil
+}
+
+func (b *FileIndexBuilder) Append(row []string) error {
+	rowKey := b.fileIndex.dataFormat.KeyOf(row)
+	if len(rowKey) < b.fileIndex.indexKeyLength {
+		return KeyTooShortForIndex
+	}
+
+	rowBytes, e := b.fileIndex.dataFormat.EncodeRow(row)
+	if e != nil {
+		return e
+	}
+
+	mutable := b.fileIndex.backend.(MutableIndexBackend)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	offset := b.dataOffset
+	indexKey := rowKey[:b.fileIndex.indexKeyLength]
+
+	if _, e := b.dataFile.Write(rowBytes); e != nil {
+		return e
+	}
+	b.dataOffset += int64(len(rowBytes))
+	atomic.StoreInt64(&b.fileIndex.dataEndOffset, b.dataOffset)
+
+	entry := IndexEntry{Offset: offset, Length: int64(len(rowBytes)), Checksum: xxhash.Sum64(rowBytes)}
+	if e := writeIndexLine(b.indexFile, indexKey, entry); e != nil {
+		return e
+	}
+
+	return mutable.Insert(indexKey, entry)
+}
+
+// Sync catches the index up with any rows appended to the data file
+// since the last indexed offset, whether written through this builder
+// or by another process. New key prefixes are indexed as they are
+// found. If the data file is now shorter than the last indexed offset,
+// the file has been truncated from under the index: every already
+// indexed row is re-hashed against the current file contents and a
+// mismatch (including a row offset that no longer fits in the file at
+// all) surfaces as ChecksumMismatchError rather than a silently wrong
+// lookup later.
+func (b *FileIndexBuilder) Sync() error {
+	mutable := b.fileIndex.backend.(MutableIndexBackend)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stat, e := b.dataFile.Stat()
+	if e != nil {
+		return e
+	}
+
+	knownEnd := atomic.LoadInt64(&b.fileIndex.dataEndOffset)
+
+	if stat.Size() < knownEnd {
+		if e := b.verifyIndexedRows(mutable, stat.Size()); e != nil {
+			return e
+		}
+		b.dataOffset = stat.Size()
+		atomic.StoreInt64(&b.fileIndex.dataEndOffset, stat.Size())
+		return nil
+	}
+
+	if stat.Size() == knownEnd {
+		return nil
+	}
+
+	readFile, e := os.Open(b.fileIndex.dataCsvPath)
+	if e != nil {
+		return e
+	}
+	defer readFile.Close()
+
+	if _, e := readFile.Seek(knownEnd, io.SeekStart); e != nil {
+		return e
+	}
+
+	counting := &countingReader{r: readFile, offset: knownEnd}
+	rowReader := b.fileIndex.dataFormat.NewReader(counting)
+
+	for true {
+		rowStart := counting.offset
+		line, e := rowReader.Read()
+		if errors.Is(e, io.EOF) {
+			break
+		}
+		if e != nil {
+			return e
+		}
+
+		rowKey := b.fileIndex.dataFormat.KeyOf(line)
+		if len(rowKey) < b.fileIndex.indexKeyLength {
+			continue
+		}
+		indexKey := rowKey[:b.fileIndex.indexKeyLength]
+
+		rowBytes, e := b.fileIndex.dataFormat.EncodeRow(line)
+		if e != nil {
+			return e
+		}
+
+		entry := IndexEntry{Offset: rowStart, Length: int64(len(rowBytes)), Checksum: xxhash.Sum64(rowBytes)}
+		if e := writeIndexLine(b.indexFile, indexKey, entry); e != nil {
+			return e
+		}
+
+		if e := mutable.Insert(indexKey, entry); e != nil {
+			return e
+		}
+	}
+
+	b.dataOffset = stat.Size()
+	atomic.StoreInt64(&b.fileIndex.dataEndOffset, stat.Size())
+
+	return nil
+}
+
+// verifyIndexedRows re-reads every row the index currently knows about
+// from currentSize bytes of (post-truncation) data and confirms its
+// checksum still matches. A row whose recorded offset no longer fits in
+// the file, or whose bytes no longer hash to the recorded checksum, is
+// reported as ChecksumMismatchError.
+func (b *FileIndexBuilder) verifyIndexedRows(mutable MutableIndexBackend, currentSize int64) error {
+	it, e := mutable.RangeScan("")
+	if e != nil {
+		return e
+	}
+	defer it.Close()
+
+	readFile, e := os.Open(b.fileIndex.dataCsvPath)
+	if e != nil {
+		return e
+	}
+	defer readFile.Close()
+
+	for it.Next() {
+		offset := it.Offset()
+		length := it.Length()
+
+		if offset+length > currentSize {
+			return ChecksumMismatchError
+		}
+
+		rowBytes := make([]byte, length)
+		if _, e := readFile.ReadAt(rowBytes, offset); e != nil {
+			return ChecksumMismatchError
+		}
+
+		if xxhash.Sum64(rowBytes) != it.Checksum() {
+			return ChecksumMismatchError
+		}
+	}
+
+	return it.Err()
+}
+
+func (b *FileIndexBuilder) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dataErr := b.dataFile.Close()
+	indexErr := b.indexFile.Close()
+	if dataErr != nil {
+		return dataErr
+	}
+	return indexErr
+}
+
+// writeIndexLine appends one index row for indexKey. It goes through
+// encoding/csv rather than a raw Fprintf so an indexKey containing a
+// comma, quote or newline round-trips correctly instead of corrupting
+// the line into extra fields.
+func writeIndexLine(w io.Writer, indexKey string, entry IndexEntry) error {
+	csvWriter := csv.NewWriter(w)
+	fields := []string{
+		indexKey,
+		strconv.FormatInt(entry.Offset, 10),
+		strconv.FormatInt(entry.Length, 10),
+		strconv.FormatUint(entry.Checksum, 10),
+	}
+	if e := csvWriter.Write(fields); e != nil {
+		return e
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// countingReader tracks the exact file offset of the next byte to be
+// read. Reads are capped to a single byte at a time: anything buffered
+// downstream (csv.Reader wraps its source in a bufio.Reader) would
+// otherwise pull ahead of the row currently being parsed, making
+// offset read after a Read() call useless as a per-row boundary.
+type countingReader struct {
+	r      io.Reader
+	offset int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	n, e := c.r.Read(p)
+	c.offset += int64(n)
+	return n, e
+}
@@ -0,0 +1,161 @@
+package cbindex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestFileIndexBuilder(t *testing.T, keyLen int) (*FileIndexBuilder, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "data.csv")
+	indexPath := filepath.Join(dir, "index.csv")
+
+	if e := os.WriteFile(dataPath, nil, 0644); e != nil {
+		t.Fatalf("write data file: %v", e)
+	}
+	if e := os.WriteFile(indexPath, nil, 0644); e != nil {
+		t.Fatalf("write index file: %v", e)
+	}
+
+	fileIndex, e := NewFileIndex(Config{
+		DataCsvPath:           dataPath,
+		IndexCsvPath:          indexPath,
+		ConcurrentHandleLimit: 2,
+		IndexKeyLength:        keyLen,
+	})
+	if e != nil {
+		t.Fatalf("NewFileIndex: %v", e)
+	}
+
+	builder, e := NewFileIndexBuilder(fileIndex)
+	if e != nil {
+		t.Fatalf("NewFileIndexBuilder: %v", e)
+	}
+
+	return builder, dataPath, indexPath
+}
+
+func TestFileIndexBuilderAppendAndGetRow(t *testing.T) {
+	builder, _, _ := newTestFileIndexBuilder(t, 3)
+	defer builder.Close()
+
+	if e := builder.Append([]string{"abc", "one"}); e != nil {
+		t.Fatalf("Append: %v", e)
+	}
+	if e := builder.Append([]string{"def", "two"}); e != nil {
+		t.Fatalf("Append: %v", e)
+	}
+
+	row, e := builder.fileIndex.GetRow("def")
+	if e != nil {
+		t.Fatalf("GetRow: %v", e)
+	}
+	if row == nil || row[1] != "two" {
+		t.Fatalf("GetRow returned %v, want [def two]", row)
+	}
+}
+
+func TestFileIndexBuilderSyncCatchesUpExternalWrites(t *testing.T) {
+	builder, dataPath, _ := newTestFileIndexBuilder(t, 3)
+	defer builder.Close()
+
+	if e := builder.Append([]string{"abc", "one"}); e != nil {
+		t.Fatalf("Append: %v", e)
+	}
+
+	// Simulate another process appending directly to the data file
+	// without going through this builder.
+	f, e := os.OpenFile(dataPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if e != nil {
+		t.Fatalf("open data file: %v", e)
+	}
+	if _, e := f.WriteString("def,two\n"); e != nil {
+		t.Fatalf("write: %v", e)
+	}
+	if e := f.Close(); e != nil {
+		t.Fatalf("close: %v", e)
+	}
+
+	if e := builder.Sync(); e != nil {
+		t.Fatalf("Sync: %v", e)
+	}
+
+	row, e := builder.fileIndex.GetRow("def")
+	if e != nil {
+		t.Fatalf("GetRow: %v", e)
+	}
+	if row == nil || row[1] != "two" {
+		t.Fatalf("GetRow returned %v, want [def two]", row)
+	}
+}
+
+func TestFileIndexBuilderSyncDetectsTruncation(t *testing.T) {
+	builder, dataPath, _ := newTestFileIndexBuilder(t, 3)
+	defer builder.Close()
+
+	if e := builder.Append([]string{"abc", "one"}); e != nil {
+		t.Fatalf("Append: %v", e)
+	}
+	if e := builder.Append([]string{"def", "two"}); e != nil {
+		t.Fatalf("Append: %v", e)
+	}
+
+	// Truncate into the middle of the first row, then append new,
+	// unrelated bytes. The file ends up 13 bytes long, short of the 16
+	// the index covers, and the first row's bytes no longer match its
+	// checksum.
+	if e := os.Truncate(dataPath, 4); e != nil {
+		t.Fatalf("truncate: %v", e)
+	}
+	f, e := os.OpenFile(dataPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if e != nil {
+		t.Fatalf("open data file: %v", e)
+	}
+	if _, e := f.WriteString("\nxyz,new\n"); e != nil {
+		t.Fatalf("write: %v", e)
+	}
+	if e := f.Close(); e != nil {
+		t.Fatalf("close: %v", e)
+	}
+
+	e = builder.Sync()
+	if e != ChecksumMismatchError {
+		t.Fatalf("Sync returned %v, want ChecksumMismatchError", e)
+	}
+}
+
+func TestWriteIndexLineEscapesCommaInKey(t *testing.T) {
+	builder, _, indexPath := newTestFileIndexBuilder(t, 5)
+	defer builder.Close()
+
+	if e := builder.Append([]string{"ab,cde", "value"}); e != nil {
+		t.Fatalf("Append: %v", e)
+	}
+
+	row, e := builder.fileIndex.GetRow("ab,cde")
+	if e != nil {
+		t.Fatalf("GetRow: %v", e)
+	}
+	if row == nil || row[1] != "value" {
+		t.Fatalf("GetRow returned %v, want [ab,cde value]", row)
+	}
+
+	// IndexKeyLength is 5, so the indexed bucket key is itself "ab,cd"
+	// (the first 5 bytes of "ab,cde", comma included). Unescaped, a raw
+	// Fprintf would split that into an extra CSV field and shift every
+	// column after it, so assert the whole bucket key survives a reload
+	// intact rather than getting truncated to "ab".
+	reloaded, e := LoadMemoryMapIndex(indexPath)
+	if e != nil {
+		t.Fatalf("LoadMemoryMapIndex: %v", e)
+	}
+	if entries, _ := reloaded.Lookup("ab"); len(entries) != 0 {
+		t.Fatalf("reloaded index contains the comma-split key %q, expected only the full %q bucket key", "ab", "ab,cd")
+	}
+	if entries, _ := reloaded.Lookup("ab,cd"); len(entries) != 1 {
+		t.Fatalf("reloaded index is missing bucket key %q", "ab,cd")
+	}
+}
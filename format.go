@@ -0,0 +1,189 @@
+package cbindex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var UnknownRowKeyFieldError = errors.New("row format could not locate the key field")
+
+type RowReader interface {
+	Read() ([]string, error)
+}
+
+type RowFormat interface {
+	NewReader(r io.Reader) RowReader
+	KeyOf(row []string) string
+	// EncodeRow renders row back into the bytes that would appear in
+	// the data file, the inverse of NewReader. FileIndexBuilder and
+	// BuildBPTreeIndex use it to write/checksum appended rows, so every
+	// RowFormat must be able to round-trip whatever rows its own
+	// RowReader hands back.
+	EncodeRow(row []string) ([]byte, error)
+}
+
+type CSVRowFormat struct{}
+
+func (CSVRowFormat) NewReader(r io.Reader) RowReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+func (CSVRowFormat) KeyOf(row []string) string {
+	if len(row) == 0 {
+		return ""
+	}
+	return row[0]
+}
+
+func (CSVRowFormat) EncodeRow(row []string) ([]byte, error) {
+	return encodeDelimitedRow(row, ',')
+}
+
+type TSVRowFormat struct{}
+
+func (TSVRowFormat) NewReader(r io.Reader) RowReader {
+	reader := csv.NewReader(r)
+	reader.Comma = '\t'
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+func (TSVRowFormat) KeyOf(row []string) string {
+	if len(row) == 0 {
+		return ""
+	}
+	return row[0]
+}
+
+func (TSVRowFormat) EncodeRow(row []string) ([]byte, error) {
+	return encodeDelimitedRow(row, '\t')
+}
+
+func encodeDelimitedRow(row []string, comma rune) ([]byte, error) {
+	var buf bytes.Buffer
+	csvWriter := csv.NewWriter(&buf)
+	csvWriter.Comma = comma
+	if e := csvWriter.Write(row); e != nil {
+		return nil, e
+	}
+	csvWriter.Flush()
+	if e := csvWriter.Error(); e != nil {
+		return nil, e
+	}
+	return buf.Bytes(), nil
+}
+
+// JSONLRowFormat reads newline-delimited JSON, extracting the index key
+// from KeyField of each decoded object. Each "row" returned by its
+// RowReader has two columns: the extracted key and the raw JSON line.
+type JSONLRowFormat struct {
+	KeyField string
+}
+
+func (f JSONLRowFormat) NewReader(r io.Reader) RowReader {
+	return &jsonlRowReader{scanner: bufio.NewScanner(r), keyField: f.KeyField}
+}
+
+func (f JSONLRowFormat) KeyOf(row []string) string {
+	if len(row) == 0 {
+		return ""
+	}
+	return row[0]
+}
+
+// EncodeRow expects row in the same [key, rawJSONLine] shape its own
+// RowReader returns and writes rawJSONLine back out with its newline.
+func (f JSONLRowFormat) EncodeRow(row []string) ([]byte, error) {
+	if len(row) < 2 {
+		return nil, UnknownRowKeyFieldError
+	}
+	return []byte(row[1] + "\n"), nil
+}
+
+type jsonlRowReader struct {
+	scanner  *bufio.Scanner
+	keyField string
+}
+
+func (r *jsonlRowReader) Read() ([]string, error) {
+	for r.scanner.Scan() {
+		line := r.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var fields map[string]interface{}
+		if e := json.Unmarshal(line, &fields); e != nil {
+			return nil, e
+		}
+
+		value, ok := fields[r.keyField]
+		if !ok {
+			return nil, UnknownRowKeyFieldError
+		}
+
+		key := fmt.Sprintf("%v", value)
+		raw := make([]byte, len(line))
+		copy(raw, line)
+		return []string{key, string(raw)}, nil
+	}
+
+	if e := r.scanner.Err(); e != nil {
+		return nil, e
+	}
+	return nil, io.EOF
+}
+
+// FixedWidthRowFormat reads records of RecordLength bytes, with the
+// index key at byte offsets [KeyStart,KeyEnd) of each record.
+type FixedWidthRowFormat struct {
+	RecordLength int
+	KeyStart     int
+	KeyEnd       int
+}
+
+func (f FixedWidthRowFormat) NewReader(r io.Reader) RowReader {
+	return &fixedWidthRowReader{r: r, format: f}
+}
+
+func (f FixedWidthRowFormat) KeyOf(row []string) string {
+	if len(row) == 0 {
+		return ""
+	}
+	return row[0]
+}
+
+// EncodeRow expects row in the same [key, record] shape its own
+// RowReader returns and writes record back out verbatim; record must
+// already be exactly RecordLength bytes.
+func (f FixedWidthRowFormat) EncodeRow(row []string) ([]byte, error) {
+	if len(row) < 2 || len(row[1]) != f.RecordLength {
+		return nil, errors.New("fixed width row does not match the configured record length")
+	}
+	return []byte(row[1]), nil
+}
+
+type fixedWidthRowReader struct {
+	r      io.Reader
+	format FixedWidthRowFormat
+}
+
+func (rr *fixedWidthRowReader) Read() ([]string, error) {
+	buf := make([]byte, rr.format.RecordLength)
+	if _, e := io.ReadFull(rr.r, buf); e != nil {
+		if errors.Is(e, io.EOF) || errors.Is(e, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, e
+	}
+
+	record := string(buf)
+	return []string{record[rr.format.KeyStart:rr.format.KeyEnd], record}, nil
+}
@@ -0,0 +1,105 @@
+package cbindex
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestJSONLRowFormatReadAndEncodeRoundTrip(t *testing.T) {
+	format := JSONLRowFormat{KeyField: "id"}
+	input := `{"id":"abc","value":1}` + "\n" + `{"id":"def","value":2}` + "\n"
+
+	reader := format.NewReader(strings.NewReader(input))
+
+	row, e := reader.Read()
+	if e != nil {
+		t.Fatalf("Read: %v", e)
+	}
+	if format.KeyOf(row) != "abc" {
+		t.Fatalf("KeyOf(%v) = %q, want %q", row, format.KeyOf(row), "abc")
+	}
+
+	encoded, e := format.EncodeRow(row)
+	if e != nil {
+		t.Fatalf("EncodeRow: %v", e)
+	}
+	if string(encoded) != `{"id":"abc","value":1}`+"\n" {
+		t.Fatalf("EncodeRow(%v) = %q, want the original JSON line", row, encoded)
+	}
+
+	if _, e := reader.Read(); e != nil {
+		t.Fatalf("second Read: %v", e)
+	}
+	if _, e := reader.Read(); e != io.EOF {
+		t.Fatalf("Read past end returned %v, want io.EOF", e)
+	}
+}
+
+func TestJSONLRowFormatEncodeRowRejectsShortRow(t *testing.T) {
+	format := JSONLRowFormat{KeyField: "id"}
+	if _, e := format.EncodeRow([]string{"onlykey"}); e != UnknownRowKeyFieldError {
+		t.Fatalf("EncodeRow returned %v, want UnknownRowKeyFieldError", e)
+	}
+}
+
+func TestTSVRowFormatReadAndEncodeRoundTrip(t *testing.T) {
+	format := TSVRowFormat{}
+	input := "abc\tone\ndef\ttwo\n"
+
+	reader := format.NewReader(strings.NewReader(input))
+
+	row, e := reader.Read()
+	if e != nil {
+		t.Fatalf("Read: %v", e)
+	}
+	if format.KeyOf(row) != "abc" {
+		t.Fatalf("KeyOf(%v) = %q, want %q", row, format.KeyOf(row), "abc")
+	}
+
+	encoded, e := format.EncodeRow(row)
+	if e != nil {
+		t.Fatalf("EncodeRow: %v", e)
+	}
+	if string(encoded) != "abc\tone\n" {
+		t.Fatalf("EncodeRow(%v) = %q, want %q", row, encoded, "abc\tone\n")
+	}
+}
+
+func TestFixedWidthRowFormatReadAndEncodeRoundTrip(t *testing.T) {
+	format := FixedWidthRowFormat{RecordLength: 6, KeyStart: 0, KeyEnd: 3}
+	input := "abc123def456"
+
+	reader := format.NewReader(bytes.NewReader([]byte(input)))
+
+	row, e := reader.Read()
+	if e != nil {
+		t.Fatalf("Read: %v", e)
+	}
+	if format.KeyOf(row) != "abc" {
+		t.Fatalf("KeyOf(%v) = %q, want %q", row, format.KeyOf(row), "abc")
+	}
+
+	encoded, e := format.EncodeRow(row)
+	if e != nil {
+		t.Fatalf("EncodeRow: %v", e)
+	}
+	if string(encoded) != "abc123" {
+		t.Fatalf("EncodeRow(%v) = %q, want %q", row, encoded, "abc123")
+	}
+
+	if _, e := reader.Read(); e != nil {
+		t.Fatalf("second Read: %v", e)
+	}
+	if _, e := reader.Read(); e != io.EOF {
+		t.Fatalf("Read past end returned %v, want io.EOF", e)
+	}
+}
+
+func TestFixedWidthRowFormatEncodeRowRejectsWrongLength(t *testing.T) {
+	format := FixedWidthRowFormat{RecordLength: 6, KeyStart: 0, KeyEnd: 3}
+	if _, e := format.EncodeRow([]string{"abc", "short"}); e == nil {
+		t.Fatalf("EncodeRow with a mismatched record length did not return an error")
+	}
+}
@@ -1,21 +1,22 @@
 package cbindex
 
 import (
-	"encoding/csv"
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"os"
-	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 )
 
 var (
-	TooManyConcurrentHandlesError = errors.New("too many concurrent handles")
-	InvalidHandleError            = errors.New("invalid handle")
-	KeyTooShortForIndex           = errors.New("provided key too short for index")
+	TooManyConcurrentHandlesError     = errors.New("too many concurrent handles")
+	InvalidHandleError                = errors.New("invalid handle")
+	KeyTooShortForIndex               = errors.New("provided key too short for index")
+	FileIndexClosedError              = errors.New("file index is closed")
+	InvalidConcurrentHandleLimitError = errors.New("config.ConcurrentHandleLimit must be positive")
 )
 
 type FileIndex struct {
@@ -27,9 +28,21 @@ type FileIndex struct {
 	warmUpDelay           time.Duration
 	indexKeyLength        int
 
-	pool            *sync.Pool
+	// slots is both the free list and the backpressure semaphore: it is
+	// pre-filled with concurrentHandleLimit nil placeholders, each
+	// representing permission to open one *os.File. acquireHandle
+	// blocks on a receive until a slot frees up or its context is
+	// cancelled; a nil placeholder is lazily turned into a real handle
+	// the first time it is received.
+	slots           chan *os.File
 	openHandleCount int32
-	index           map[string]int
+	createdHandles  int32
+	closed          int32
+
+	backend    IndexBackend
+	dataFormat RowFormat
+
+	dataEndOffset int64
 }
 
 type Config struct {
@@ -39,39 +52,70 @@ type Config struct {
 	WarmUpCount           int
 	WarmUpDelay           time.Duration
 	IndexKeyLength        int
+
+	// Backend overrides the index lookup backend. If nil, IndexCsvPath
+	// is loaded into a MemoryMapIndex, matching the original behavior.
+	Backend IndexBackend
+
+	// DataFormat controls how rows are read from DataCsvPath. If nil,
+	// CSVRowFormat is used, matching the original behavior.
+	DataFormat RowFormat
 }
 
 func NewFileIndex(config Config) (*FileIndex, error) {
+	if config.ConcurrentHandleLimit <= 0 {
+		return nil, InvalidConcurrentHandleLimitError
+	}
+
 	_, e := os.Stat(config.DataCsvPath)
 	if errors.Is(e, os.ErrNotExist) {
 		return nil, errors.New("data csv file does not exist")
 	}
-	_, e = os.Stat(config.IndexCsvPath)
-	if errors.Is(e, os.ErrNotExist) {
-		return nil, errors.New("index csv file does not exist")
-	}
 
-	indexFile, e := os.Open(config.IndexCsvPath)
-	if e != nil {
-		return nil, e
-	}
-
-	index := make(map[string]int)
+	backend := config.Backend
+	if backend == nil {
+		_, e = os.Stat(config.IndexCsvPath)
+		if errors.Is(e, os.ErrNotExist) {
+			return nil, errors.New("index csv file does not exist")
+		}
 
-	indexCsv := csv.NewReader(indexFile)
-	for true {
-		line, e := indexCsv.Read()
-		if errors.Is(e, io.EOF) {
-			break
+		memoryIndex, e := LoadMemoryMapIndex(config.IndexCsvPath)
+		if e != nil {
+			return nil, e
 		}
+		backend = memoryIndex
+	}
+
+	dataFormat := config.DataFormat
+	if dataFormat == nil {
+		dataFormat = CSVRowFormat{}
+	}
 
-		key := line[0]
-		offset, e := strconv.ParseInt(line[1], 10, 64)
+	// A mutable index starts from the end of its last indexed row, so a
+	// builder's first Sync catches up on rows appended while no builder
+	// was running.
+	var dataEndOffset int64
+	if _, ok := backend.(MutableIndexBackend); ok {
+		it, e := backend.Seek("")
 		if e != nil {
-			continue
+			return nil, e
+		}
+		for it.Next() {
+			if end := it.Offset() + it.Length(); end > dataEndOffset {
+				dataEndOffset = end
+			}
+		}
+		it.Close()
+		if e := it.Err(); e != nil {
+			return nil, e
 		}
+	} else if dataStat, e := os.Stat(config.DataCsvPath); e == nil {
+		dataEndOffset = dataStat.Size()
+	}
 
-		index[key] = int(offset)
+	slots := make(chan *os.File, config.ConcurrentHandleLimit)
+	for i := int32(0); i < config.ConcurrentHandleLimit; i++ {
+		slots <- nil
 	}
 
 	fileIndex := &FileIndex{
@@ -81,46 +125,97 @@ func NewFileIndex(config Config) (*FileIndex, error) {
 		warmUpCount:           config.WarmUpCount,
 		warmUpDelay:           config.WarmUpDelay,
 		indexKeyLength:        config.IndexKeyLength,
-		pool: &sync.Pool{
-			New: func() interface{} {
-				file, e := os.Open(config.DataCsvPath)
-				if e != nil {
-					return nil
-				}
-				return file
-			},
-		},
-		index: index,
+		slots:                 slots,
+		backend:               backend,
+		dataFormat:            dataFormat,
+		dataEndOffset:         dataEndOffset,
 	}
 	return fileIndex, nil
 }
 
-func (f *FileIndex) acquireHandle() (*os.File, error) {
-	count := atomic.LoadInt32(&f.openHandleCount)
-	if count > f.concurrentHandleLimit {
-		return nil, TooManyConcurrentHandlesError
+// acquireHandle blocks until a handle is available or ctx is cancelled.
+// Every returned handle must be passed to releaseHandle exactly once,
+// even on error paths, so its slot is never lost.
+func (f *FileIndex) acquireHandle(ctx context.Context) (*os.File, error) {
+	if atomic.LoadInt32(&f.closed) != 0 {
+		return nil, FileIndexClosedError
 	}
 
-	atomic.AddInt32(&f.openHandleCount, 1)
+	select {
+	case handle, ok := <-f.slots:
+		if !ok {
+			return nil, FileIndexClosedError
+		}
 
-	handle := f.pool.Get().(*os.File)
-	if handle == nil {
-		return nil, InvalidHandleError
+		atomic.AddInt32(&f.openHandleCount, 1)
+
+		if handle != nil {
+			return handle, nil
+		}
+
+		file, e := os.Open(f.dataCsvPath)
+		if e != nil {
+			atomic.AddInt32(&f.openHandleCount, -1)
+			f.slots <- nil
+			return nil, e
+		}
+		atomic.AddInt32(&f.createdHandles, 1)
+		return file, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	return handle, nil
 }
 
 func (f *FileIndex) releaseHandle(handle *os.File) {
-	if handle != nil {
-		atomic.AddInt32(&f.openHandleCount, -1)
-		f.pool.Put(handle)
+	if handle == nil {
+		return
 	}
+	atomic.AddInt32(&f.openHandleCount, -1)
+	f.slots <- handle
+}
+
+// InFlight returns the number of handles currently checked out.
+func (f *FileIndex) InFlight() int32 {
+	return atomic.LoadInt32(&f.openHandleCount)
+}
+
+// PoolSize returns the number of *os.File handles that have been
+// opened so far, at most ConcurrentHandleLimit.
+func (f *FileIndex) PoolSize() int32 {
+	return atomic.LoadInt32(&f.createdHandles)
+}
+
+// Close drains the handle pool and closes every cached *os.File. It
+// must only be called once all outstanding handles have been released
+// and no further calls into FileIndex are in flight.
+func (f *FileIndex) Close() error {
+	if !atomic.CompareAndSwapInt32(&f.closed, 0, 1) {
+		return FileIndexClosedError
+	}
+
+	var firstErr error
+	for i := int32(0); i < f.concurrentHandleLimit; i++ {
+		handle := <-f.slots
+		if handle == nil {
+			continue
+		}
+		if e := handle.Close(); e != nil && firstErr == nil {
+			firstErr = e
+		}
+	}
+	close(f.slots)
+
+	if backendErr := f.backend.Close(); firstErr == nil {
+		firstErr = backendErr
+	}
+
+	return firstErr
 }
 
 func (f *FileIndex) WarmUp() error {
 	var handles []*os.File
 	for i := 0; i < f.warmUpCount; i++ {
-		handle, e := f.acquireHandle()
+		handle, e := f.acquireHandle(context.Background())
 		if e != nil {
 			return e
 		}
@@ -141,41 +236,27 @@ func (f *FileIndex) GetRow(rowKey string) ([]string, error) {
 	}
 	indexKey := rowKey[:f.indexKeyLength]
 
-	offset, ok := f.index[indexKey]
-
-	if !ok {
-		return nil, nil
-	}
-
-	handle, e := f.acquireHandle()
+	entries, e := f.backend.Lookup(indexKey)
 	if e != nil {
 		return nil, e
 	}
-	defer f.releaseHandle(handle)
+	if len(entries) == 0 {
+		return nil, nil
+	}
 
-	_, e = handle.Seek(int64(offset), io.SeekStart)
+	handle, e := f.acquireHandle(context.Background())
 	if e != nil {
 		return nil, e
 	}
-	csvReader := csv.NewReader(handle)
-
-	for true {
-		line, e := csvReader.Read()
-
-		if errors.Is(e, io.EOF) {
-			break
-		}
-
-		if len(line[0]) < f.indexKeyLength {
-			continue
-		}
-		key := line[0][:f.indexKeyLength]
+	defer f.releaseHandle(handle)
 
-		if key != indexKey {
-			break
+	for _, entry := range entries {
+		line, e := f.readEntryRow(handle, entry)
+		if e != nil {
+			return nil, e
 		}
 
-		if line[0] == rowKey {
+		if f.dataFormat.KeyOf(line) == rowKey {
 			return line, nil
 		}
 	}
@@ -190,42 +271,28 @@ func (f *FileIndex) GetRowsByPartialKey(rowKey string, limit int) ([][]string, e
 	}
 	indexKey := rowKey[:f.indexKeyLength]
 
-	offset, ok := f.index[indexKey]
-
-	if !ok {
-		return rows, nil
-	}
-
-	handle, e := f.acquireHandle()
+	entries, e := f.backend.Lookup(indexKey)
 	if e != nil {
 		return rows, e
 	}
-	defer f.releaseHandle(handle)
+	if len(entries) == 0 {
+		return rows, nil
+	}
 
-	_, e = handle.Seek(int64(offset), io.SeekStart)
+	handle, e := f.acquireHandle(context.Background())
 	if e != nil {
 		return rows, e
 	}
+	defer f.releaseHandle(handle)
 
-	csvReader := csv.NewReader(handle)
-
-	for true {
-		line, e := csvReader.Read()
-
-		if errors.Is(e, io.EOF) {
-			break
-		}
-
-		if len(line[0]) < f.indexKeyLength {
-			continue
-		}
-		key := line[0][:f.indexKeyLength]
-
-		if key != indexKey {
-			break
+	for _, entry := range entries {
+		line, e := f.readEntryRow(handle, entry)
+		if e != nil {
+			return rows, e
 		}
 
-		if strings.Contains(strings.ToLower(line[0]), strings.ToLower(rowKey)) {
+		rowKeyField := f.dataFormat.KeyOf(line)
+		if strings.Contains(strings.ToLower(rowKeyField), strings.ToLower(rowKey)) {
 			rows = append(rows, line)
 			if len(rows) >= limit && limit != -1 {
 				return rows, nil
@@ -235,3 +302,20 @@ func (f *FileIndex) GetRowsByPartialKey(rowKey string, limit int) ([][]string, e
 
 	return rows, nil
 }
+
+// readEntryRow decodes the single row recorded at entry with one ReadAt
+// of its exact, previously recorded length, rather than seeking and
+// streaming through a RowReader.
+func (f *FileIndex) readEntryRow(handle *os.File, entry IndexEntry) ([]string, error) {
+	buf := make([]byte, entry.Length)
+	if _, e := handle.ReadAt(buf, entry.Offset); e != nil {
+		return nil, e
+	}
+
+	rowReader := f.dataFormat.NewReader(bytes.NewReader(buf))
+	line, e := rowReader.Read()
+	if e != nil && !errors.Is(e, io.EOF) {
+		return nil, e
+	}
+	return line, nil
+}
@@ -0,0 +1,139 @@
+package cbindex
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDataAndIndexFiles(t *testing.T, rows string) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "data.csv")
+	indexPath := filepath.Join(dir, "index.csv")
+
+	if e := os.WriteFile(dataPath, nil, 0644); e != nil {
+		t.Fatalf("write data file: %v", e)
+	}
+	if e := os.WriteFile(indexPath, nil, 0644); e != nil {
+		t.Fatalf("write index file: %v", e)
+	}
+
+	fileIndex, e := NewFileIndex(Config{
+		DataCsvPath:           dataPath,
+		IndexCsvPath:          indexPath,
+		ConcurrentHandleLimit: 4,
+		IndexKeyLength:        3,
+	})
+	if e != nil {
+		t.Fatalf("NewFileIndex: %v", e)
+	}
+
+	builder, e := NewFileIndexBuilder(fileIndex)
+	if e != nil {
+		t.Fatalf("NewFileIndexBuilder: %v", e)
+	}
+	for _, line := range []string{"abc,1", "def,2", "ghi,3"} {
+		if e := builder.Append([]string{line[:3], line[4:]}); e != nil {
+			t.Fatalf("Append: %v", e)
+		}
+	}
+	if e := builder.Close(); e != nil {
+		t.Fatalf("close builder: %v", e)
+	}
+	if e := fileIndex.Close(); e != nil {
+		t.Fatalf("close fileIndex: %v", e)
+	}
+
+	return dataPath, indexPath
+}
+
+func TestNewFileIndexRejectsNonPositiveConcurrentHandleLimit(t *testing.T) {
+	dataPath, indexPath := newTestDataAndIndexFiles(t, "")
+
+	for _, limit := range []int32{0, -1} {
+		_, e := NewFileIndex(Config{
+			DataCsvPath:           dataPath,
+			IndexCsvPath:          indexPath,
+			ConcurrentHandleLimit: limit,
+			IndexKeyLength:        3,
+		})
+		if e != InvalidConcurrentHandleLimitError {
+			t.Fatalf("NewFileIndex with ConcurrentHandleLimit=%d returned %v, want InvalidConcurrentHandleLimitError", limit, e)
+		}
+	}
+}
+
+func TestFileIndexHandlePoolUnderConcurrentUse(t *testing.T) {
+	dataPath, indexPath := newTestDataAndIndexFiles(t, "")
+
+	const limit = 3
+	fileIndex, e := NewFileIndex(Config{
+		DataCsvPath:           dataPath,
+		IndexCsvPath:          indexPath,
+		ConcurrentHandleLimit: limit,
+		IndexKeyLength:        3,
+	})
+	if e != nil {
+		t.Fatalf("NewFileIndex: %v", e)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, e := fileIndex.GetRow("def"); e != nil {
+				t.Errorf("GetRow: %v", e)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if inFlight := fileIndex.InFlight(); inFlight != 0 {
+		t.Fatalf("InFlight() = %d after all goroutines finished, want 0", inFlight)
+	}
+	if poolSize := fileIndex.PoolSize(); poolSize > limit {
+		t.Fatalf("PoolSize() = %d, want at most ConcurrentHandleLimit %d", poolSize, limit)
+	}
+
+	if e := fileIndex.Close(); e != nil {
+		t.Fatalf("Close: %v", e)
+	}
+	if _, e := fileIndex.GetRow("def"); e != FileIndexClosedError {
+		t.Fatalf("GetRow after Close returned %v, want FileIndexClosedError", e)
+	}
+}
+
+func TestFileIndexAcquireHandleRespectsContextCancellation(t *testing.T) {
+	dataPath, indexPath := newTestDataAndIndexFiles(t, "")
+
+	fileIndex, e := NewFileIndex(Config{
+		DataCsvPath:           dataPath,
+		IndexCsvPath:          indexPath,
+		ConcurrentHandleLimit: 1,
+		IndexKeyLength:        3,
+	})
+	if e != nil {
+		t.Fatalf("NewFileIndex: %v", e)
+	}
+	defer fileIndex.Close()
+
+	// Exhaust the only slot so the next acquire has to wait.
+	held, e := fileIndex.acquireHandle(context.Background())
+	if e != nil {
+		t.Fatalf("acquireHandle: %v", e)
+	}
+	defer fileIndex.releaseHandle(held)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, e := fileIndex.acquireHandle(ctx); e != context.DeadlineExceeded {
+		t.Fatalf("acquireHandle with exhausted pool returned %v, want context.DeadlineExceeded", e)
+	}
+}
@@ -0,0 +1,180 @@
+package cbindex
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+)
+
+type RowIterator interface {
+	Next() bool
+	Row() []string
+	Err() error
+	Close() error
+}
+
+// GetRowsByPrefix returns every row whose key starts with prefix, up to
+// limit rows (or unbounded if limit is -1). Unlike Iterate, which must
+// fall back to a full forward Seek because it has no upper bound on the
+// key space, this can hand the prefix straight to the backend's
+// RangeScan, which only visits the index buckets that prefix can match.
+func (f *FileIndex) GetRowsByPrefix(prefix string, limit int) ([][]string, error) {
+	bucketPrefix := prefix
+	if len(bucketPrefix) > f.indexKeyLength {
+		bucketPrefix = bucketPrefix[:f.indexKeyLength]
+	}
+
+	backendIt, e := f.backend.RangeScan(bucketPrefix)
+	if e != nil {
+		return nil, e
+	}
+
+	it := &fileRowIterator{
+		fileIndex: f,
+		ctx:       context.Background(),
+		startKey:  prefix,
+		backendIt: backendIt,
+	}
+	defer it.Close()
+
+	var rows [][]string
+	for it.Next() {
+		row := it.Row()
+		if !strings.HasPrefix(f.dataFormat.KeyOf(row), prefix) {
+			continue
+		}
+
+		rows = append(rows, row)
+		if limit != -1 && len(rows) >= limit {
+			break
+		}
+	}
+
+	return rows, it.Err()
+}
+
+func (f *FileIndex) Iterate(startKey string) (RowIterator, error) {
+	return f.IterateContext(context.Background(), startKey)
+}
+
+// IterateContext returns rows bucket by bucket in ascending index-key
+// order, starting at startKey's bucket and skipping rows whose key is
+// < startKey. Rows that share a bucket come in the order they were
+// indexed; they are not sorted by full key. Unlike GetRowsByPrefix,
+// iteration here is unbounded above, so it uses Seek rather than
+// RangeScan.
+func (f *FileIndex) IterateContext(ctx context.Context, startKey string) (RowIterator, error) {
+	bucketKey := startKey
+	if len(bucketKey) > f.indexKeyLength {
+		bucketKey = bucketKey[:f.indexKeyLength]
+	}
+
+	backendIt, e := f.backend.Seek(bucketKey)
+	if e != nil {
+		return nil, e
+	}
+
+	return &fileRowIterator{
+		fileIndex: f,
+		ctx:       ctx,
+		startKey:  startKey,
+		backendIt: backendIt,
+	}, nil
+}
+
+type fileRowIterator struct {
+	fileIndex *FileIndex
+	ctx       context.Context
+	startKey  string
+
+	backendIt Iterator
+	handle    *os.File
+
+	row  []string
+	err  error
+	done bool
+}
+
+// Next advances to the next entry the backend iterator yields, decoding
+// each with a single ReadAt of its recorded length rather than seeking
+// and streaming, and skips entries preceding startKey. Checking startKey
+// per entry (rather than a "seen the start" flag plus assumed file
+// order) keeps this correct even when a bucket's entries were appended
+// out of key order.
+func (it *fileRowIterator) Next() bool {
+	if it.done {
+		return false
+	}
+
+	for it.backendIt.Next() {
+		if e := it.ctx.Err(); e != nil {
+			it.err = e
+			it.done = true
+			return false
+		}
+
+		if it.handle == nil {
+			handle, e := it.fileIndex.acquireHandle(it.ctx)
+			if e != nil {
+				it.err = e
+				it.done = true
+				return false
+			}
+			it.handle = handle
+		}
+
+		buf := make([]byte, it.backendIt.Length())
+		if _, e := it.handle.ReadAt(buf, it.backendIt.Offset()); e != nil {
+			it.err = e
+			it.done = true
+			return false
+		}
+
+		rowReader := it.fileIndex.dataFormat.NewReader(bytes.NewReader(buf))
+		line, e := rowReader.Read()
+		if e != nil {
+			it.err = e
+			it.done = true
+			return false
+		}
+
+		key := it.fileIndex.dataFormat.KeyOf(line)
+		if key < it.startKey {
+			continue
+		}
+
+		it.row = line
+		return true
+	}
+
+	if e := it.backendIt.Err(); e != nil {
+		it.err = e
+	}
+	it.done = true
+	return false
+}
+
+func (it *fileRowIterator) Row() []string {
+	return it.row
+}
+
+func (it *fileRowIterator) Err() error {
+	return it.err
+}
+
+func (it *fileRowIterator) Close() error {
+	it.done = true
+
+	var backendErr error
+	if it.backendIt != nil {
+		backendErr = it.backendIt.Close()
+	}
+
+	if it.handle != nil {
+		it.fileIndex.releaseHandle(it.handle)
+		it.handle = nil
+	}
+
+	return backendErr
+}
@@ -0,0 +1,136 @@
+package cbindex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestFileIndexWithRows(t *testing.T, rows string, keyLen int) *FileIndex {
+	t.Helper()
+
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "data.csv")
+	indexPath := filepath.Join(dir, "index.csv")
+
+	if e := os.WriteFile(dataPath, nil, 0644); e != nil {
+		t.Fatalf("write data file: %v", e)
+	}
+	if e := os.WriteFile(indexPath, nil, 0644); e != nil {
+		t.Fatalf("write index file: %v", e)
+	}
+
+	fileIndex, e := NewFileIndex(Config{
+		DataCsvPath:           dataPath,
+		IndexCsvPath:          indexPath,
+		ConcurrentHandleLimit: 2,
+		IndexKeyLength:        keyLen,
+	})
+	if e != nil {
+		t.Fatalf("NewFileIndex: %v", e)
+	}
+
+	indexBuilder, e := NewFileIndexBuilder(fileIndex)
+	if e != nil {
+		t.Fatalf("NewFileIndexBuilder: %v", e)
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(rows, "\n"), "\n") {
+		if e := indexBuilder.Append(strings.Split(line, ",")); e != nil {
+			t.Fatalf("Append(%q): %v", line, e)
+		}
+	}
+
+	if e := indexBuilder.Close(); e != nil {
+		t.Fatalf("close builder: %v", e)
+	}
+
+	return fileIndex
+}
+
+func TestIterateReturnsRowsInOrderFromStartKey(t *testing.T) {
+	fileIndex := newTestFileIndexWithRows(t, "aaa,1\nbbb,2\nccc,3\nddd,4\n", 3)
+	defer fileIndex.Close()
+
+	it, e := fileIndex.Iterate("bbb")
+	if e != nil {
+		t.Fatalf("Iterate: %v", e)
+	}
+	defer it.Close()
+
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Row()[0])
+	}
+	if e := it.Err(); e != nil {
+		t.Fatalf("iterator error: %v", e)
+	}
+
+	want := []string{"bbb", "ccc", "ddd"}
+	if len(keys) != len(want) {
+		t.Fatalf("Iterate returned %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("Iterate returned %v, want %v", keys, want)
+		}
+	}
+}
+
+func TestGetRowsByPrefixUsesRangeScan(t *testing.T) {
+	fileIndex := newTestFileIndexWithRows(t, "aaa001,1\naaa002,2\nbbb001,3\n", 3)
+	defer fileIndex.Close()
+
+	rows, e := fileIndex.GetRowsByPrefix("aaa", -1)
+	if e != nil {
+		t.Fatalf("GetRowsByPrefix: %v", e)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("GetRowsByPrefix returned %d rows, want 2: %v", len(rows), rows)
+	}
+	for _, row := range rows {
+		if row[0] != "aaa001" && row[0] != "aaa002" {
+			t.Fatalf("GetRowsByPrefix returned unexpected row %v", row)
+		}
+	}
+}
+
+func TestGetRowInterleavedAppendsAcrossBuckets(t *testing.T) {
+	// abc1 and abc9 share the 3-byte bucket key "abc", but xyz2 (a
+	// different bucket) is appended between them. A bucket that only
+	// remembered its first offset and scanned forward until the prefix
+	// changed would lose abc9 here.
+	fileIndex := newTestFileIndexWithRows(t, "abc1,1\nxyz2,2\nabc9,3\n", 3)
+	defer fileIndex.Close()
+
+	row, e := fileIndex.GetRow("abc9")
+	if e != nil {
+		t.Fatalf("GetRow: %v", e)
+	}
+	if row == nil || row[1] != "3" {
+		t.Fatalf("GetRow(\"abc9\") returned %v, want [abc9 3]", row)
+	}
+
+	row, e = fileIndex.GetRow("abc1")
+	if e != nil {
+		t.Fatalf("GetRow: %v", e)
+	}
+	if row == nil || row[1] != "1" {
+		t.Fatalf("GetRow(\"abc1\") returned %v, want [abc1 1]", row)
+	}
+}
+
+func TestGetRowsByPrefixRespectsLimit(t *testing.T) {
+	fileIndex := newTestFileIndexWithRows(t, "aaa001,1\naaa002,2\nbbb001,3\n", 3)
+	defer fileIndex.Close()
+
+	rows, e := fileIndex.GetRowsByPrefix("aaa", 1)
+	if e != nil {
+		t.Fatalf("GetRowsByPrefix: %v", e)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("GetRowsByPrefix with limit 1 returned %d rows, want 1", len(rows))
+	}
+}
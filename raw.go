@@ -0,0 +1,117 @@
+package cbindex
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+var RowNotFoundError = errors.New("row not found")
+
+type rowSpan struct {
+	offset int64
+	length int64
+}
+
+// GetRowRaw returns the exact bytes of rowKey's row. The index records
+// an (offset, length) for every row but keys it only by bucket, so the
+// row is found by reading and decoding each entry of its bucket until
+// one's key matches; its bytes are then read with one more ReadAt.
+func (f *FileIndex) GetRowRaw(rowKey string) ([]byte, error) {
+	span, ok, e := f.resolveRowSpan(rowKey)
+	if e != nil {
+		return nil, e
+	}
+	if !ok {
+		return nil, RowNotFoundError
+	}
+
+	handle, e := f.acquireHandle(context.Background())
+	if e != nil {
+		return nil, e
+	}
+	defer f.releaseHandle(handle)
+
+	buf := make([]byte, span.length)
+	if _, e := handle.ReadAt(buf, span.offset); e != nil {
+		return nil, e
+	}
+
+	return buf, nil
+}
+
+// GetRowRange returns a bounded, closable reader over [byteStart,
+// byteEnd) of rowKey's row, useful when a row carries a large embedded
+// blob the caller wants to stream rather than load in full.
+func (f *FileIndex) GetRowRange(rowKey string, byteStart, byteEnd int64) (io.ReadCloser, error) {
+	span, ok, e := f.resolveRowSpan(rowKey)
+	if e != nil {
+		return nil, e
+	}
+	if !ok {
+		return nil, RowNotFoundError
+	}
+	if byteStart < 0 || byteEnd > span.length || byteStart > byteEnd {
+		return nil, errors.New("requested byte range is out of bounds for the row")
+	}
+
+	handle, e := f.acquireHandle(context.Background())
+	if e != nil {
+		return nil, e
+	}
+
+	section := io.NewSectionReader(handle, span.offset+byteStart, byteEnd-byteStart)
+
+	return &rowRangeReader{fileIndex: f, handle: handle, section: section}, nil
+}
+
+type rowRangeReader struct {
+	fileIndex *FileIndex
+	handle    *os.File
+	section   *io.SectionReader
+}
+
+func (r *rowRangeReader) Read(p []byte) (int, error) {
+	return r.section.Read(p)
+}
+
+func (r *rowRangeReader) Close() error {
+	r.fileIndex.releaseHandle(r.handle)
+	return nil
+}
+
+func (f *FileIndex) resolveRowSpan(rowKey string) (rowSpan, bool, error) {
+	if len(rowKey) < f.indexKeyLength {
+		return rowSpan{}, false, KeyTooShortForIndex
+	}
+
+	indexKey := rowKey[:f.indexKeyLength]
+
+	entries, e := f.backend.Lookup(indexKey)
+	if e != nil {
+		return rowSpan{}, false, e
+	}
+	if len(entries) == 0 {
+		return rowSpan{}, false, nil
+	}
+
+	handle, e := f.acquireHandle(context.Background())
+	if e != nil {
+		return rowSpan{}, false, e
+	}
+	defer f.releaseHandle(handle)
+
+	for _, entry := range entries {
+		line, e := f.readEntryRow(handle, entry)
+		if e != nil {
+			return rowSpan{}, false, e
+		}
+
+		if f.dataFormat.KeyOf(line) == rowKey {
+			return rowSpan{offset: entry.Offset, length: entry.Length}, true, nil
+		}
+	}
+
+	return rowSpan{}, false, nil
+}
@@ -0,0 +1,51 @@
+package cbindex
+
+import (
+	"io"
+	"testing"
+)
+
+func TestGetRowRawReturnsExactRowBytes(t *testing.T) {
+	fileIndex := newTestFileIndexWithRows(t, "abc1,one\nxyz2,two\nabc9,three\n", 3)
+	defer fileIndex.Close()
+
+	raw, e := fileIndex.GetRowRaw("abc9")
+	if e != nil {
+		t.Fatalf("GetRowRaw: %v", e)
+	}
+	if string(raw) != "abc9,three\n" {
+		t.Fatalf("GetRowRaw(\"abc9\") = %q, want %q", raw, "abc9,three\n")
+	}
+
+	if _, e := fileIndex.GetRowRaw("missing"); e != RowNotFoundError {
+		t.Fatalf("GetRowRaw of missing key returned %v, want RowNotFoundError", e)
+	}
+}
+
+func TestGetRowRangeReturnsBoundedSlice(t *testing.T) {
+	fileIndex := newTestFileIndexWithRows(t, "abc1,hello-world\n", 3)
+	defer fileIndex.Close()
+
+	r, e := fileIndex.GetRowRange("abc1", 0, 5)
+	if e != nil {
+		t.Fatalf("GetRowRange: %v", e)
+	}
+	defer r.Close()
+
+	buf, e := io.ReadAll(r)
+	if e != nil {
+		t.Fatalf("ReadAll: %v", e)
+	}
+	if string(buf) != "abc1," {
+		t.Fatalf("GetRowRange(0,5) = %q, want %q", buf, "abc1,")
+	}
+}
+
+func TestGetRowRangeRejectsOutOfBoundsRange(t *testing.T) {
+	fileIndex := newTestFileIndexWithRows(t, "abc1,hi\n", 3)
+	defer fileIndex.Close()
+
+	if _, e := fileIndex.GetRowRange("abc1", 0, 1000); e == nil {
+		t.Fatalf("GetRowRange with an out-of-bounds end did not return an error")
+	}
+}